@@ -1,6 +1,7 @@
 #ifndef LOGGER_H
 #define LOGGER_H
 
+#include <stdbool.h>
 #include <stddef.h>
 #include <stdint.h>
 
@@ -63,6 +64,39 @@ void Warn(const String msg);
 void Error(const String msg);
 void Fatal(const String msg);
 void Panic(const String msg);
+void DebugHex(const String label, const uint8_t *data, size_t len);
+// Log n messages at one level with a single write, each line prefixed and
+// colored as with the single message call. Fatal and Panic have no batch form
+// since they exit after the first message.
+void DebugBatch(const String *msgs, size_t n);
+void OkayBatch(const String *msgs, size_t n);
+void InfoBatch(const String *msgs, size_t n);
+void WarnBatch(const String *msgs, size_t n);
+void ErrorBatch(const String *msgs, size_t n);
+// Renders the appended pid, host, version, commit and seq fields in the given
+// color escape, "" renders them in the line's color.
+void SetFieldColor(const String ansi);
+// Colors the message apart from the label, "" keeps the terminal default.
+void SetMessageColor(LogLevel level, const String ansi);
+// Version and commit for the fields added by SetIncludeBuildInfo, empty values
+// are left out.
+void SetBuildInfo(const String version, const String commit);
+// Logs one message in the given color instead of the level's color.
+void LogColor(LogLevel level, const String ansi, const String msg);
+void Log(LogLevel level, const String msg);
+// Picks the level from the status class: 2xx LOkay, 3xx LInfo, 4xx LWarn,
+// 5xx LError, anything else LInfo. SetStatusLevelFunc overrides the mapping.
+void LogHTTPStatus(int code, const String msg);
+// Called for every message dropped because its level is below the configured
+// one, NULL clears it.
+void SetSuppressedHook(void (*hook)(LogLevel level, const String msg));
+// Only writes lines matching the POSIX extended regular expression, or with
+// SetExcludeFilter only lines not matching it. The pattern is matched against
+// the level label, message and fields without colors. Fatal and Panic are never
+// filtered out, and configured actions still run for hidden lines. An empty
+// pattern clears the filter, an invalid one returns false and changes nothing.
+bool SetFilter(const String pattern);
+bool SetExcludeFilter(const String pattern);
 String MTTempl(const char *, ...);
 #else
 typedef struct {
@@ -81,6 +115,21 @@ void Warn(const _GoString_ msg);
 void Error(const _GoString_ msg);
 void Fatal(const _GoString_ msg);
 void Panic(const _GoString_ msg);
+void DebugHex(const _GoString_ label, const uint8_t *data, size_t len);
+void DebugBatch(const _GoString_ *msgs, size_t n);
+void OkayBatch(const _GoString_ *msgs, size_t n);
+void InfoBatch(const _GoString_ *msgs, size_t n);
+void WarnBatch(const _GoString_ *msgs, size_t n);
+void ErrorBatch(const _GoString_ *msgs, size_t n);
+void SetFieldColor(const _GoString_ ansi);
+void SetMessageColor(LogLevel level, const _GoString_ ansi);
+void SetBuildInfo(const _GoString_ version, const _GoString_ commit);
+void LogColor(LogLevel level, const _GoString_ ansi, const _GoString_ msg);
+void Log(LogLevel level, const _GoString_ msg);
+void LogHTTPStatus(int code, const _GoString_ msg);
+void SetSuppressedHook(void (*hook)(LogLevel level, const _GoString_ msg));
+bool SetFilter(const _GoString_ pattern);
+bool SetExcludeFilter(const _GoString_ pattern);
 _GoString_ MTTempl(const char *, ...);
 #endif // STRING_IMPLEMENTATION
 
@@ -104,6 +153,116 @@ typedef struct {
   ActionItem *on_fatal;
 } Action;
 
+// Colors are on by default, the environment is read once on first use.
+// NO_COLOR (non-empty) turns colors off. FORCE_COLOR takes precedence over it:
+// 0 or false turns colors off, 1 limits colors to 16, 2 to 256 and 3 allows
+// truecolor. Any other value, including empty or true, turns colors on at 16.
+// The logger's own colors are 16 color codes. Custom escapes given to
+// SetFieldColor, SetMessageColor and LogColor are downgraded to the FORCE_COLOR
+// depth, and passed through unchanged when FORCE_COLOR is unset.
+
 void Configure(LogLevel level, LogStyle style, Action *action);
 
+// Only levels at or above the given one are colored, LDebug (the default)
+// colors everything. Has no effect while colors are disabled.
+void SetMinColorLevel(LogLevel level);
+
+// Replaces the status code to level mapping of LogHTTPStatus, NULL restores
+// the default.
+void SetStatusLevelFunc(LogLevel (*f)(int code));
+
+// Called synchronously with the old and new level whenever Configure or
+// SetVerbosity change it, NULL clears it.
+void SetOnLevelChange(void (*callback)(LogLevel old_level, LogLevel new_level));
+
+// Sets the level from a count of -v flags: 0 is LWarn, 1 is LInfo and 2 or
+// more is LDebug. Has no effect before Configure. Verbosity() maps back.
+void SetVerbosity(int64_t n);
+int64_t Verbosity(void);
+
+// Whether messages of the given level are written to a terminal, the same check
+// used for wrapping and the error bell. Each stream is checked once and cached,
+// call RefreshTTY() after redirecting stdout or stderr (e.g. with dup2).
+bool IsTerminal(LogLevel level);
+void RefreshTTY(void);
+
+// Only every n-th message of the given level is written, n <= 1 disables sampling.
+// Warnings and above are never sampled. Configured actions still run for
+// dropped messages.
+void SetLevelSampling(LogLevel level, int64_t n);
+uint64_t SampledDropped(LogLevel level);
+
+// Writes every level, including Fatal and Panic, to stdout instead of stderr.
+void SetSingleStream(bool enabled);
+
+// Called synchronously right before Fatal or Panic exit the process, after
+// pending actions finished. It must be fast and must not block, NULL clears it.
+void SetOnFatal(void (*callback)(void));
+
+// Limits how long Fatal and Panic wait for pending actions such as mails before
+// exiting anyway, ms <= 0 (the default) waits until they finish.
+void SetExitFlushTimeout(int64_t ms);
+
+// Called with exit code 1 instead of exit() once Fatal or Panic are done, NULL
+// restores the default. Meant for tests: if it returns, so does the log call.
+void SetExitFunc(void (*exit)(int));
+
+// Drops messages past n lines per second, n <= 0 disables the cap.
+// Fatal and Panic are never dropped.
+void SetMaxLinesPerSecond(int64_t n);
+
+// Buffers stdout in size bytes to batch writes, size <= 0 disables buffering.
+// Buffering delays output: lines show up once the buffer fills, on Flush(),
+// right before a line is written to stderr, and at exit() or return from main.
+// Stderr is never buffered, and flushing ahead of its lines keeps them in order
+// when both streams go to the same file. Go programs don't run C exit handlers,
+// so they must call Flush() before exiting.
+void SetBuffered(int64_t size);
+void Flush(void);
+
+// Flushes the buffer right after every Error, Fatal and Panic line, so the last
+// error before a crash is written out even when it went into the buffer. Off by
+// default to keep buffered throughput, but strongly recommended for services.
+void SetFlushOnError(bool enabled);
+
+// Writes an Error message only once when the same text is logged again within
+// window_ms, e.g. by each layer of a call stack. The count of dropped repeats
+// is written before the next error that isn't a repeat. Configured actions
+// still run for every repeat. window_ms <= 0 (the default) disables it.
+void SetErrorDedup(int64_t window_ms);
+
+// Appends a seq=N counter to every written line, starting at 1.
+void SetSequenceNumbers(bool enabled);
+
+// Debugging aid that prefixes every line with the sequence number and the time
+// since it was first enabled, as in [0001 +12ms][INFO]. Uses the same counter
+// as SetSequenceNumbers.
+void SetDebugPrefix(bool enabled);
+
+// Appends pid=N and host=NAME fields to every written line.
+void SetIncludePID(bool enabled);
+void SetIncludeHostname(bool enabled);
+
+// Appends the version=... commit=... fields given to SetBuildInfo.
+void SetIncludeBuildInfo(bool enabled);
+
+// Escapes newlines and other control characters, including the ESC that starts
+// ANSI sequences, in logged messages. Off by default; turn it on whenever
+// messages may contain untrusted input, to prevent forged log lines and
+// terminal escape injection.
+void SetSanitizeInput(bool enabled);
+
+// Repeats the level prefix and color on each line of multi-line messages.
+void SetPrefixEachLine(bool enabled);
+
+// Wraps messages at the terminal's width when writing to a terminal, with
+// continuation lines indented to align after the prefix. Off by default.
+// SetWrapWidth overrides the detected width, n <= 0 goes back to detecting it.
+void SetWrap(bool enabled);
+void SetWrapWidth(int64_t n);
+
+// Rings the terminal bell with Error, Fatal and Panic lines. Only applies when
+// the output is a terminal.
+void SetBellOnError(bool enabled);
+
 #endif // LOGGER_H
@@ -1,16 +1,22 @@
 use std::{
+    cell::RefCell,
     ffi,
     fmt::Arguments,
-    mem, process, ptr, slice, str, string,
+    fs,
+    io::{self, BufWriter, IsTerminal, Write},
+    mem,
+    os::fd::FromRawFd,
+    process, ptr, slice, str, string,
     sync::{
-        atomic::{AtomicPtr, Ordering},
-        Mutex,
+        atomic::{AtomicBool, AtomicPtr, AtomicU64, AtomicU8, Ordering},
+        Mutex, OnceLock,
     },
     thread,
+    time::{Duration, Instant, SystemTime, UNIX_EPOCH},
 };
 
 #[repr(C)]
-#[derive(PartialEq, PartialOrd)]
+#[derive(Clone, Copy, PartialEq, PartialOrd)]
 pub enum LogLevel {
     LDebug = 0,
     LOkay = 1,
@@ -22,6 +28,7 @@ pub enum LogLevel {
 }
 
 #[repr(C)]
+#[derive(Clone, Copy)]
 pub enum LogStyle {
     SBrackets = 0,
     SColon = 1,
@@ -88,6 +95,60 @@ pub struct LoggerConfig {
 
 static CONFIG: AtomicPtr<LoggerConfig> = AtomicPtr::new(ptr::null_mut());
 static PENDING: Mutex<Vec<thread::JoinHandle<()>>> = Mutex::new(Vec::new());
+static EXIT_FLUSH_TIMEOUT_MS: AtomicU64 = AtomicU64::new(0);
+static ON_LEVEL_CHANGE: Mutex<Option<unsafe extern "C" fn(LogLevel, LogLevel)>> = Mutex::new(None);
+static STATUS_LEVEL_FUNC: Mutex<Option<unsafe extern "C" fn(ffi::c_int) -> LogLevel>> =
+    Mutex::new(None);
+// Stored as a raw pointer so the common case of no hook costs a single load per dropped message.
+static SUPPRESSED_HOOK: AtomicPtr<()> = AtomicPtr::new(ptr::null_mut());
+static ON_FATAL: Mutex<Option<unsafe extern "C" fn()>> = Mutex::new(None);
+static EXIT_FUNC: Mutex<Option<unsafe extern "C" fn(ffi::c_int)>> = Mutex::new(None);
+static COLOR_DEPTH: OnceLock<u8> = OnceLock::new();
+static MIN_COLOR_LEVEL: AtomicU64 = AtomicU64::new(LogLevel::LDebug as u64);
+static SINGLE_STREAM: AtomicBool = AtomicBool::new(false);
+// Set once a write to stdout (index 0) or stderr (index 1) failed and the warning was written.
+static WRITE_FAILED: [AtomicBool; 2] = [const { AtomicBool::new(false) }; 2];
+static SANITIZE_INPUT: AtomicBool = AtomicBool::new(false);
+static PREFIX_EACH_LINE: AtomicBool = AtomicBool::new(false);
+static BELL_ON_ERROR: AtomicBool = AtomicBool::new(false);
+static WRAP: AtomicBool = AtomicBool::new(false);
+static WRAP_WIDTH: AtomicU64 = AtomicU64::new(0);
+// Cached isatty result for stdout (index 0) and stderr (index 1): 0 is unknown, 1 no and 2 yes.
+static IS_TERMINAL: [AtomicU8; 2] = [const { AtomicU8::new(0) }; 2];
+static MESSAGE_COLOR: Mutex<[Option<string::String>; 7]> = Mutex::new([const { None }; 7]);
+static FIELD_COLOR: Mutex<Option<string::String>> = Mutex::new(None);
+// Include (index 0) and exclude (index 1) patterns set by SetFilter and SetExcludeFilter.
+thread_local! {
+    // Lines collected by a *Batch call for the given stream, written with a single write.
+    static BATCH: RefCell<Option<(bool, string::String)>> = const { RefCell::new(None) };
+}
+static FILTERS: Mutex<[Option<Box<Regex>>; 2]> = Mutex::new([None, None]);
+static INCLUDE_PID: AtomicBool = AtomicBool::new(false);
+static INCLUDE_HOSTNAME: AtomicBool = AtomicBool::new(false);
+static HOSTNAME: OnceLock<string::String> = OnceLock::new();
+static INCLUDE_BUILD_INFO: AtomicBool = AtomicBool::new(false);
+static BUILD_INFO: Mutex<string::String> = Mutex::new(string::String::new());
+static SEQUENCE_NUMBERS: AtomicBool = AtomicBool::new(false);
+static SEQUENCE: AtomicU64 = AtomicU64::new(0);
+static DEBUG_PREFIX: AtomicBool = AtomicBool::new(false);
+static DEBUG_START: OnceLock<Instant> = OnceLock::new();
+static BUFFERED: Mutex<Option<BufWriter<RawStream>>> = Mutex::new(None);
+static FLUSH_AT_EXIT: AtomicBool = AtomicBool::new(false);
+static FLUSH_ON_ERROR: AtomicBool = AtomicBool::new(false);
+static ERROR_DEDUP_MS: AtomicU64 = AtomicU64::new(0);
+// Text of the last written error, when it was written and how many repeats were dropped since.
+static LAST_ERROR: Mutex<Option<(string::String, Instant, u64)>> = Mutex::new(None);
+
+// Global line rate circuit breaker, MAX_LINES_PER_SECOND of 0 disables it.
+static MAX_LINES_PER_SECOND: AtomicU64 = AtomicU64::new(0);
+static LINE_WINDOW: AtomicU64 = AtomicU64::new(0);
+static LINE_COUNT: AtomicU64 = AtomicU64::new(0);
+
+// Per level sampling state, indexed by LogLevel. A rate of 0 means every message is written.
+static SAMPLE_RATE: [AtomicU64; 7] = [const { AtomicU64::new(0) }; 7];
+static SAMPLE_SEEN: [AtomicU64; 7] = [const { AtomicU64::new(0) }; 7];
+static SAMPLE_DROPPED: [AtomicU64; 7] = [const { AtomicU64::new(0) }; 7];
+static SAMPLE_UNREPORTED: [AtomicU64; 7] = [const { AtomicU64::new(0) }; 7];
 
 const COLOR_WARN: &str = "\x1b[33m";
 const COLOR_INFO: &str = "\x1b[0;36m";
@@ -164,8 +225,590 @@ pub unsafe extern "C" fn Configure(level: LogLevel, style: LogStyle, action: *mu
     let old_ptr = CONFIG.swap(new_config, Ordering::SeqCst);
 
     if !old_ptr.is_null() {
+        let old_level = (*old_ptr).level;
         drop(Box::from_raw(old_ptr));
+
+        let on_level_change = *ON_LEVEL_CHANGE.lock().unwrap();
+        if let Some(f) = on_level_change {
+            if old_level != level {
+                f(old_level, level);
+            }
+        }
+    }
+}
+
+// Registers a callback run after Configure or SetVerbosity change the level, NULL clears it.
+#[no_mangle]
+pub unsafe extern "C" fn SetOnLevelChange(
+    callback: Option<unsafe extern "C" fn(LogLevel, LogLevel)>,
+) {
+    *ON_LEVEL_CHANGE.lock().unwrap() = callback;
+}
+
+// Maps a count of -v flags to a level: 0 is Warn, 1 is Info and 2 or more is Debug. Style and
+// action are kept, so this only has an effect after Configure.
+#[no_mangle]
+pub unsafe extern "C" fn SetVerbosity(n: i64) {
+    let ptr = CONFIG.load(Ordering::Acquire);
+    if ptr.is_null() {
+        return;
+    }
+
+    let level = match n {
+        i64::MIN..=0 => LogLevel::LWarn,
+        1 => LogLevel::LInfo,
+        _ => LogLevel::LDebug,
+    };
+    Configure(level, (*ptr).style, (*ptr).action);
+}
+
+// Inverse of SetVerbosity, Okay counts as Info.
+#[no_mangle]
+pub unsafe extern "C" fn Verbosity() -> i64 {
+    let ptr = CONFIG.load(Ordering::Acquire);
+    if ptr.is_null() {
+        return 0;
+    }
+
+    match (*ptr).level {
+        LogLevel::LDebug => 2,
+        LogLevel::LOkay | LogLevel::LInfo => 1,
+        _ => 0,
+    }
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn SetLevelSampling(level: LogLevel, n: i64) {
+    // Warnings and above are never sampled so important messages can't be dropped by accident.
+    if level >= LogLevel::LWarn {
+        return;
+    }
+
+    let rate = if n > 1 { n as u64 } else { 0 };
+    SAMPLE_RATE[level as usize].store(rate, Ordering::Relaxed);
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn SampledDropped(level: LogLevel) -> u64 {
+    SAMPLE_DROPPED[level as usize].load(Ordering::Relaxed)
+}
+
+// Decides whether a message of the given level is written. When it is, also returns how many
+// messages of that level were dropped since the last one that got through, so it can be reported.
+fn sample(log_level: &LogLevel) -> (bool, u64) {
+    let idx = *log_level as usize;
+    let rate = SAMPLE_RATE[idx].load(Ordering::Relaxed);
+    if rate == 0 {
+        return (true, 0);
+    }
+
+    if SAMPLE_SEEN[idx].fetch_add(1, Ordering::Relaxed) % rate == 0 {
+        (true, SAMPLE_UNREPORTED[idx].swap(0, Ordering::Relaxed))
+    } else {
+        SAMPLE_DROPPED[idx].fetch_add(1, Ordering::Relaxed);
+        SAMPLE_UNREPORTED[idx].fetch_add(1, Ordering::Relaxed);
+        (false, 0)
+    }
+}
+
+// Color depth read once from the environment: 0 is no colors, 1 is 16 colors, 2 is 256 colors
+// and 3 is truecolor. FORCE_COLOR takes precedence over NO_COLOR and follows the Node.js
+// convention: 0 or false disables colors, 1 to 3 set the depth and any other value (including
+// empty or true) means 16 colors. Without FORCE_COLOR, escapes are passed through unchanged.
+fn color_depth() -> u8 {
+    *COLOR_DEPTH.get_or_init(|| match std::env::var("FORCE_COLOR") {
+        Ok(v) if v == "0" || v == "false" => 0,
+        Ok(v) => v.parse::<u8>().map_or(1, |depth| depth.clamp(1, 3)),
+        Err(_) => match std::env::var_os("NO_COLOR") {
+            Some(v) if !v.is_empty() => 0,
+            _ => 3,
+        },
+    })
+}
+
+fn colors_enabled() -> bool {
+    color_depth() > 0
+}
+
+// Rewrites 256 color and truecolor SGR parameters in a custom escape string so they fit the
+// FORCE_COLOR depth. The logger's own escapes are all basic 16 color codes and need no rewriting.
+fn fit_color_depth(code: &str) -> string::String {
+    let depth = color_depth();
+    if depth >= 3 {
+        return code.to_owned();
+    }
+
+    let mut result = string::String::new();
+    let mut rest = code;
+    while let Some(start) = rest.find("\x1b[") {
+        result.push_str(&rest[..start]);
+        let seq = &rest[start + 2..];
+        match seq.find(|c: char| !c.is_ascii_digit() && c != ';') {
+            Some(end) if seq[end..].starts_with('m') => {
+                result.push_str(&format!("\x1b[{}m", downgrade_sgr(&seq[..end], depth)));
+                rest = &seq[end + 1..];
+            }
+            _ => {
+                result.push_str("\x1b[");
+                rest = seq;
+            }
+        }
+    }
+    result.push_str(rest);
+    result
+}
+
+fn downgrade_sgr(params: &str, depth: u8) -> string::String {
+    let params: Vec<u32> = params.split(';').map(|p| p.parse().unwrap_or(0)).collect();
+    let mut result: Vec<string::String> = Vec::new();
+
+    let mut i = 0;
+    while i < params.len() {
+        let p = params[i];
+        if p == 38 || p == 48 {
+            // Foreground colors start at 30 and background colors at 40.
+            let base = p - 8;
+            match params.get(i + 1..) {
+                Some([5, n, ..]) => {
+                    result.push(if depth >= 2 {
+                        format!("{};5;{}", p, n)
+                    } else {
+                        ansi256_to_16(base, *n).to_string()
+                    });
+                    i += 3;
+                    continue;
+                }
+                Some([2, r, g, b, ..]) => {
+                    result.push(if depth >= 2 {
+                        format!("{};5;{}", p, rgb_to_ansi256(*r, *g, *b))
+                    } else {
+                        rgb_to_ansi16(base, *r, *g, *b).to_string()
+                    });
+                    i += 5;
+                    continue;
+                }
+                _ => {}
+            }
+        }
+        result.push(p.to_string());
+        i += 1;
+    }
+
+    result.join(";")
+}
+
+fn rgb_to_ansi256(r: u32, g: u32, b: u32) -> u32 {
+    if r == g && g == b {
+        return match r {
+            0..=7 => 16,
+            249.. => 231,
+            _ => 232 + ((r - 8) as f64 / 247.0 * 24.0).round() as u32,
+        };
+    }
+
+    let level = |c: u32| (c as f64 / 255.0 * 5.0).round() as u32;
+    16 + 36 * level(r) + 6 * level(g) + level(b)
+}
+
+fn ansi256_to_16(base: u32, n: u32) -> u32 {
+    match n {
+        0..=7 => base + n,
+        8..=15 => base + 60 + n - 8,
+        16..=231 => {
+            let steps = [0, 95, 135, 175, 215, 255];
+            let n = n - 16;
+            rgb_to_ansi16(
+                base,
+                steps[(n / 36) as usize],
+                steps[(n / 6 % 6) as usize],
+                steps[(n % 6) as usize],
+            )
+        }
+        _ => {
+            let v = 8 + (n.min(255) - 232) * 10;
+            rgb_to_ansi16(base, v, v, v)
+        }
+    }
+}
+
+fn rgb_to_ansi16(base: u32, r: u32, g: u32, b: u32) -> u32 {
+    let brightness = (r.max(g).max(b) as f64 / 255.0 * 2.0).round() as u32;
+    if brightness == 0 {
+        return base;
+    }
+
+    let bit = |c: u32| (c as f64 / 255.0).round() as u32;
+    let code = base + (bit(b) << 2 | bit(g) << 1 | bit(r));
+    if brightness == 2 {
+        code + 60
+    } else {
+        code
+    }
+}
+
+// Levels below the given one are written without colors.
+#[no_mangle]
+pub unsafe extern "C" fn SetMinColorLevel(level: LogLevel) {
+    MIN_COLOR_LEVEL.store(level as u64, Ordering::Relaxed);
+}
+
+fn paint(code: &'static str) -> &'static str {
+    if colors_enabled() {
+        code
+    } else {
+        ""
+    }
+}
+
+// Registers a cleanup callback run right before Fatal or Panic exit the process, NULL clears it.
+#[no_mangle]
+pub unsafe extern "C" fn SetOnFatal(callback: Option<unsafe extern "C" fn()>) {
+    *ON_FATAL.lock().unwrap() = callback;
+}
+
+// Replaces the process::exit call made by Fatal and Panic, NULL restores it.
+#[no_mangle]
+pub unsafe extern "C" fn SetExitFunc(exit: Option<unsafe extern "C" fn(ffi::c_int)>) {
+    *EXIT_FUNC.lock().unwrap() = exit;
+}
+
+// Routes every level to stdout, for container log collectors that treat stderr as errors.
+#[no_mangle]
+pub unsafe extern "C" fn SetSingleStream(enabled: bool) {
+    SINGLE_STREAM.store(enabled, Ordering::Relaxed);
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn SetMaxLinesPerSecond(n: i64) {
+    MAX_LINES_PER_SECOND.store(if n > 0 { n as u64 } else { 0 }, Ordering::Relaxed);
+}
+
+// Counts the line against the current one second window and reports whether the cap was
+// exceeded. The first line over the cap in a window emits a single throttle notice.
+fn over_line_rate() -> bool {
+    let max = MAX_LINES_PER_SECOND.load(Ordering::Relaxed);
+    if max == 0 {
+        return false;
+    }
+
+    let now = SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .map(|d| d.as_secs())
+        .unwrap_or(0);
+    let window = LINE_WINDOW.load(Ordering::Relaxed);
+    if window != now
+        && LINE_WINDOW
+            .compare_exchange(window, now, Ordering::Relaxed, Ordering::Relaxed)
+            .is_ok()
+    {
+        LINE_COUNT.store(0, Ordering::Relaxed);
+    }
+
+    let count = LINE_COUNT.fetch_add(1, Ordering::Relaxed);
+    if count == max {
+        write_line(
+            writes_to_stdout(&LogLevel::LWarn),
+            format_args!(
+                "{}[WARN] logger: more than {} lines in one second, dropping output{}",
+                paint(COLOR_WARN),
+                max,
+                paint(RESET),
+            ),
+        );
+    }
+
+    count >= max
+}
+
+// Wraps stdout in a buffer of the given size to batch writes, size <= 0 flushes and removes it.
+// Stderr stays unbuffered so warnings and errors show up immediately. The buffer is flushed
+// before every stderr line, so lines keep their order when both streams go to the same file.
+#[no_mangle]
+pub unsafe extern "C" fn SetBuffered(size: i64) {
+    let mut buffered = BUFFERED.lock().unwrap();
+    if let Some(out) = buffered.as_mut() {
+        let _ = out.flush();
     }
+
+    *buffered = if size > 0 {
+        if !FLUSH_AT_EXIT.swap(true, Ordering::Relaxed) {
+            atexit(flush_at_exit);
+        }
+        Some(BufWriter::with_capacity(size as usize, RawStream::stdout()))
+    } else {
+        None
+    };
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn Flush() {
+    if let Some(out) = BUFFERED.lock().unwrap().as_mut() {
+        let _ = out.flush();
+    }
+}
+
+// Flushes the buffer after every Error, Fatal and Panic line, so the last error before a crash
+// is on disk even when SetSingleStream routes it into the buffer.
+#[no_mangle]
+pub unsafe extern "C" fn SetFlushOnError(enabled: bool) {
+    FLUSH_ON_ERROR.store(enabled, Ordering::Relaxed);
+}
+
+extern "C" {
+    fn atexit(callback: extern "C" fn()) -> ffi::c_int;
+}
+
+// Registered the first time buffering is turned on, so returning from main or calling exit()
+// doesn't lose buffered lines.
+extern "C" fn flush_at_exit() {
+    unsafe { Flush() }
+}
+
+// Escapes control characters in messages so untrusted input can't forge lines or send terminal
+// escapes. Only the caller's message is touched, never the logger's own prefix and colors.
+#[no_mangle]
+pub unsafe extern "C" fn SetSanitizeInput(enabled: bool) {
+    SANITIZE_INPUT.store(enabled, Ordering::Relaxed);
+}
+
+fn sanitize(message: &str) -> string::String {
+    let mut result = string::String::with_capacity(message.len());
+    for c in message.chars() {
+        match c {
+            '\n' => result.push_str("\\n"),
+            '\r' => result.push_str("\\r"),
+            '\t' => result.push(c),
+            c if c.is_control() => result.push_str(&format!("\\x{:02x}", c as u32)),
+            c => result.push(c),
+        }
+    }
+    result
+}
+
+// Repeats the level prefix and color on every line of a multi-line message.
+#[no_mangle]
+pub unsafe extern "C" fn SetPrefixEachLine(enabled: bool) {
+    PREFIX_EACH_LINE.store(enabled, Ordering::Relaxed);
+}
+
+// Rings the terminal bell on Error, Fatal and Panic lines written to a terminal.
+#[no_mangle]
+pub unsafe extern "C" fn SetBellOnError(enabled: bool) {
+    BELL_ON_ERROR.store(enabled, Ordering::Relaxed);
+}
+
+// Wraps messages written to a terminal at the terminal's width, or the SetWrapWidth override.
+#[no_mangle]
+pub unsafe extern "C" fn SetWrap(enabled: bool) {
+    WRAP.store(enabled, Ordering::Relaxed);
+}
+
+// Overrides the detected terminal width used for wrapping, n <= 0 goes back to detecting it.
+#[no_mangle]
+pub unsafe extern "C" fn SetWrapWidth(n: i64) {
+    WRAP_WIDTH.store(if n > 0 { n as u64 } else { 0 }, Ordering::Relaxed);
+}
+
+#[cfg(any(
+    target_os = "linux",
+    target_os = "android",
+    target_os = "macos",
+    target_os = "ios",
+    target_os = "freebsd",
+    target_os = "openbsd",
+    target_os = "netbsd",
+    target_os = "dragonfly",
+))]
+mod winsize {
+    use std::ffi;
+
+    #[repr(C)]
+    #[derive(Default)]
+    struct Winsize {
+        ws_row: u16,
+        ws_col: u16,
+        ws_xpixel: u16,
+        ws_ypixel: u16,
+    }
+
+    #[cfg(any(target_os = "linux", target_os = "android"))]
+    const TIOCGWINSZ: ffi::c_ulong = 0x5413;
+    #[cfg(not(any(target_os = "linux", target_os = "android")))]
+    const TIOCGWINSZ: ffi::c_ulong = 0x40087468;
+
+    extern "C" {
+        fn ioctl(fd: ffi::c_int, request: ffi::c_ulong, ...) -> ffi::c_int;
+    }
+
+    // Columns of the terminal behind the stream, or 0 if it can't be queried. Asked on every
+    // wrapped line so resizing the terminal is picked up.
+    pub fn terminal_width(to_stdout: bool) -> usize {
+        let mut size = Winsize::default();
+        let fd = if to_stdout { 1 } else { 2 };
+        if unsafe { ioctl(fd, TIOCGWINSZ, &mut size as *mut Winsize) } == 0 {
+            size.ws_col as usize
+        } else {
+            0
+        }
+    }
+}
+
+// TIOCGWINSZ differs between the remaining Unix targets, there the width is only known through
+// SetWrapWidth and wrapping is off otherwise.
+#[cfg(not(any(
+    target_os = "linux",
+    target_os = "android",
+    target_os = "macos",
+    target_os = "ios",
+    target_os = "freebsd",
+    target_os = "openbsd",
+    target_os = "netbsd",
+    target_os = "dragonfly",
+)))]
+mod winsize {
+    pub fn terminal_width(_to_stdout: bool) -> usize {
+        0
+    }
+}
+
+use winsize::terminal_width;
+
+// Number of columns the text takes up on a terminal, ANSI escape sequences are not counted.
+fn visible_width(text: &str) -> usize {
+    let mut width = 0;
+    let mut chars = text.chars();
+    while let Some(c) = chars.next() {
+        if c == '\x1b' {
+            // Skip to the final byte of the CSI sequence.
+            if chars.next() == Some('[') {
+                while let Some(c) = chars.next() {
+                    if ('\x40'..='\x7e').contains(&c) {
+                        break;
+                    }
+                }
+            }
+            continue;
+        }
+        width += 1;
+    }
+    width
+}
+
+// Wraps each line of the message at word boundaries so it fits in width columns. The first line
+// starts after an indent wide prefix and continuation lines are indented to align with it.
+fn wrap_message(message: &str, indent: usize, width: usize) -> string::String {
+    let mut result = string::String::new();
+
+    for (n, line) in message.split('\n').enumerate() {
+        if n > 0 {
+            result.push('\n');
+        }
+
+        let mut col = if n == 0 { indent } else { 0 };
+        for (i, word) in line.split(' ').enumerate() {
+            let word_width = visible_width(word);
+            if i > 0 {
+                if col > indent && col + 1 + word_width > width {
+                    result.push('\n');
+                    result.push_str(&" ".repeat(indent));
+                    col = indent;
+                } else {
+                    result.push(' ');
+                    col += 1;
+                }
+            }
+            result.push_str(word);
+            col += word_width;
+        }
+    }
+
+    result
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn SetIncludePID(enabled: bool) {
+    INCLUDE_PID.store(enabled, Ordering::Relaxed);
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn SetIncludeHostname(enabled: bool) {
+    INCLUDE_HOSTNAME.store(enabled, Ordering::Relaxed);
+}
+
+// Stores the version and commit appended by SetIncludeBuildInfo, empty values are left out.
+#[no_mangle]
+pub unsafe extern "C" fn SetBuildInfo(version: String, commit: String) {
+    let mut info = string::String::new();
+    for (key, value) in [("version", version), ("commit", commit)] {
+        let value = slice::from_raw_parts(value.data as *const u8, value.len as usize);
+        if !value.is_empty() {
+            info.push_str(&format!(
+                " {}={}",
+                key,
+                string::String::from_utf8_lossy(value)
+            ));
+        }
+    }
+    *BUILD_INFO.lock().unwrap() = info;
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn SetIncludeBuildInfo(enabled: bool) {
+    INCLUDE_BUILD_INFO.store(enabled, Ordering::Relaxed);
+}
+
+extern "C" {
+    fn gethostname(name: *mut ffi::c_char, len: usize) -> ffi::c_int;
+}
+
+// Looked up once and reused for every line.
+fn hostname() -> &'static str {
+    HOSTNAME.get_or_init(|| {
+        let mut buf = [0 as ffi::c_char; 256];
+        if unsafe { gethostname(buf.as_mut_ptr(), buf.len() - 1) } != 0 {
+            return "unknown".to_owned();
+        }
+        unsafe { ffi::CStr::from_ptr(buf.as_ptr()) }
+            .to_string_lossy()
+            .into_owned()
+    })
+}
+
+// Colors the message separately from the label for the given level, an empty string leaves the
+// message in the terminal's default color. Until set, the message shares the label color.
+#[no_mangle]
+pub unsafe extern "C" fn SetMessageColor(level: LogLevel, ansi: String) {
+    let code = slice::from_raw_parts(ansi.data as *const u8, ansi.len as usize);
+    MESSAGE_COLOR.lock().unwrap()[level as usize] =
+        Some(fit_color_depth(str::from_utf8(code).unwrap_or("")));
+}
+
+// Color escape for the appended pid, host, version, commit and seq fields, an empty string
+// renders them in the line's color.
+#[no_mangle]
+pub unsafe extern "C" fn SetFieldColor(ansi: String) {
+    let code = slice::from_raw_parts(ansi.data as *const u8, ansi.len as usize);
+    *FIELD_COLOR.lock().unwrap() = match str::from_utf8(code) {
+        Ok(code) if !code.is_empty() => Some(fit_color_depth(code)),
+        _ => None,
+    };
+}
+
+// Appends a seq=N field to every written line, numbered from 1 since process start.
+#[no_mangle]
+pub unsafe extern "C" fn SetSequenceNumbers(enabled: bool) {
+    SEQUENCE_NUMBERS.store(enabled, Ordering::Relaxed);
+}
+
+// Development aid for startup ordering: prefixes every line with the sequence number and the
+// milliseconds since the mode was first enabled, as in [0001 +12ms][INFO]. Shares the counter
+// with SetSequenceNumbers, so both show the same number for a line.
+#[no_mangle]
+pub unsafe extern "C" fn SetDebugPrefix(enabled: bool) {
+    if enabled {
+        DEBUG_START.get_or_init(Instant::now);
+    }
+    DEBUG_PREFIX.store(enabled, Ordering::Relaxed);
 }
 
 unsafe fn parse_template(template: &[u8], level_str: &str, msg: &[u8]) -> *mut ffi::c_char {
@@ -396,14 +1039,319 @@ unsafe fn handle_action(log_level: &LogLevel, msg: &String) {
     }
 }
 
+// Bounds how long Fatal and Panic wait for pending actions (e.g. mails) before exiting anyway,
+// ms <= 0 waits for as long as they take.
+#[no_mangle]
+pub unsafe extern "C" fn SetExitFlushTimeout(ms: i64) {
+    EXIT_FLUSH_TIMEOUT_MS.store(if ms > 0 { ms as u64 } else { 0 }, Ordering::Relaxed);
+}
+
+// Registers a hook called with the level and message of every message dropped by level
+// filtering, NULL clears it.
+#[no_mangle]
+pub unsafe extern "C" fn SetSuppressedHook(hook: Option<unsafe extern "C" fn(LogLevel, String)>) {
+    let hook = hook.map_or(ptr::null_mut(), |f| f as *mut ());
+    SUPPRESSED_HOOK.store(hook, Ordering::Release);
+}
+
+// Compiled POSIX extended regular expression. regex_t differs in size between libcs, 64 bytes on
+// glibc and smaller elsewhere, so it is kept in an opaque buffer at least as large.
+#[repr(C, align(8))]
+struct Regex([u8; 256]);
+
+unsafe impl Send for Regex {}
+
+const REG_EXTENDED: ffi::c_int = 1;
+
+extern "C" {
+    fn regcomp(preg: *mut Regex, pattern: *const ffi::c_char, cflags: ffi::c_int) -> ffi::c_int;
+    fn regexec(
+        preg: *const Regex,
+        string: *const ffi::c_char,
+        nmatch: usize,
+        pmatch: *mut ffi::c_void,
+        eflags: ffi::c_int,
+    ) -> ffi::c_int;
+    fn regfree(preg: *mut Regex);
+}
+
+impl Regex {
+    // Boxed so the compiled pattern never moves after regcomp.
+    fn new(pattern: &str) -> Option<Box<Regex>> {
+        let pattern = ffi::CString::new(pattern).ok()?;
+        let mut re = Box::new(Regex([0; 256]));
+        if unsafe { regcomp(&mut *re, pattern.as_ptr(), REG_EXTENDED) } == 0 {
+            Some(re)
+        } else {
+            None
+        }
+    }
+
+    fn is_match(&self, text: &str) -> bool {
+        // C strings end at the first NUL, so only the text before it can be matched.
+        let text = text.split('\0').next().unwrap_or("");
+        let text = ffi::CString::new(text).unwrap();
+        unsafe { regexec(self, text.as_ptr(), 0, ptr::null_mut(), 0) == 0 }
+    }
+}
+
+impl Drop for Regex {
+    fn drop(&mut self) {
+        unsafe { regfree(self) }
+    }
+}
+
+unsafe fn set_filter(idx: usize, pattern: String) -> bool {
+    let pattern = slice::from_raw_parts(pattern.data as *const u8, pattern.len as usize);
+    let re = match str::from_utf8(pattern) {
+        Ok("") => None,
+        Ok(pattern) => match Regex::new(pattern) {
+            Some(re) => Some(re),
+            None => return false,
+        },
+        Err(_) => return false,
+    };
+    FILTERS.lock().unwrap()[idx] = re;
+    true
+}
+
+// Only lines matching the POSIX extended regular expression are written, an empty pattern clears
+// the filter. Returns false and keeps the previous filter if the pattern doesn't compile.
+#[no_mangle]
+pub unsafe extern "C" fn SetFilter(pattern: String) -> bool {
+    set_filter(0, pattern)
+}
+
+// Lines matching the pattern are not written, the inverse of SetFilter.
+#[no_mangle]
+pub unsafe extern "C" fn SetExcludeFilter(pattern: String) -> bool {
+    set_filter(1, pattern)
+}
+
+// Whether SetFilter or SetExcludeFilter hide the line. It is only built when a filter is set.
+fn filtered_out(line: impl FnOnce() -> string::String) -> bool {
+    let filters = FILTERS.lock().unwrap();
+    let [include, exclude] = &*filters;
+    if include.is_none() && exclude.is_none() {
+        return false;
+    }
+
+    let line = line();
+    include.as_ref().map_or(false, |re| !re.is_match(&line))
+        || exclude.as_ref().map_or(false, |re| re.is_match(&line))
+}
+
+// Collapses identical Error messages logged within window_ms of the first one, ms <= 0 disables
+// it. The number of dropped repeats is reported before the next error that gets written.
+#[no_mangle]
+pub unsafe extern "C" fn SetErrorDedup(window_ms: i64) {
+    ERROR_DEDUP_MS.store(
+        if window_ms > 0 { window_ms as u64 } else { 0 },
+        Ordering::Relaxed,
+    );
+    *LAST_ERROR.lock().unwrap() = None;
+}
+
+// Whether the error repeats the last one within the dedup window. When it doesn't, also returns
+// how many repeats of the previous one were dropped, so they can be reported.
+fn duplicate_error(message: &str) -> (bool, u64) {
+    let window = ERROR_DEDUP_MS.load(Ordering::Relaxed);
+    if window == 0 {
+        return (false, 0);
+    }
+
+    let mut last = LAST_ERROR.lock().unwrap();
+    if let Some((text, since, repeats)) = last.as_mut() {
+        if text == message && since.elapsed() < Duration::from_millis(window) {
+            *repeats += 1;
+            return (true, 0);
+        }
+    }
+
+    let repeats = last.take().map_or(0, |(_, _, repeats)| repeats);
+    *last = Some((message.to_owned(), Instant::now(), 0));
+    (false, repeats)
+}
+
+unsafe fn suppressed(log_level: LogLevel, msg: String) {
+    let hook = SUPPRESSED_HOOK.load(Ordering::Acquire);
+    if hook.is_null() {
+        return;
+    }
+
+    let f: unsafe extern "C" fn(LogLevel, String) = mem::transmute(hook);
+    f(log_level, msg);
+}
+
 fn drain_pending() {
-    let handles: Vec<_> = PENDING.lock().unwrap().drain(..).collect();
-    for h in handles {
-        h.join().unwrap();
+    let mut handles: Vec<_> = PENDING.lock().unwrap().drain(..).collect();
+
+    let timeout = EXIT_FLUSH_TIMEOUT_MS.load(Ordering::Relaxed);
+    if timeout == 0 {
+        for h in handles {
+            h.join().unwrap();
+        }
+        return;
+    }
+
+    let deadline = Instant::now() + Duration::from_millis(timeout);
+    loop {
+        let (finished, running): (Vec<_>, Vec<_>) =
+            handles.into_iter().partition(|h| h.is_finished());
+        for h in finished {
+            h.join().unwrap();
+        }
+
+        handles = running;
+        if handles.is_empty() {
+            return;
+        }
+        if Instant::now() >= deadline {
+            break;
+        }
+        thread::sleep(Duration::from_millis(1));
+    }
+
+    write_line(
+        writes_to_stdout(&LogLevel::LWarn),
+        format_args!(
+            "{}[WARN] logger: {} pending action(s) did not finish within {}ms, exiting anyway{}",
+            paint(COLOR_WARN),
+            handles.len(),
+            timeout,
+            paint(RESET),
+        ),
+    );
+}
+
+fn writes_to_stdout(log_level: &LogLevel) -> bool {
+    if SINGLE_STREAM.load(Ordering::Relaxed) {
+        true
+    } else if *log_level == LogLevel::LPanic {
+        // TODO: Handle panic with special care
+        false
+    } else {
+        *log_level < LogLevel::LWarn
+    }
+}
+
+// Checked once per stream and cached until RefreshTTY, so the hot path doesn't pay for an isatty
+// call.
+fn stream_is_terminal(to_stdout: bool) -> bool {
+    let idx = if to_stdout { 0 } else { 1 };
+    match IS_TERMINAL[idx].load(Ordering::Relaxed) {
+        0 => {
+            let is_tty = if to_stdout {
+                io::stdout().is_terminal()
+            } else {
+                io::stderr().is_terminal()
+            };
+            IS_TERMINAL[idx].store(if is_tty { 2 } else { 1 }, Ordering::Relaxed);
+            is_tty
+        }
+        cached => cached == 2,
+    }
+}
+
+// Drops the cached terminal checks, for programs that redirect stdout or stderr after logging
+// started, e.g. by dup2 when daemonizing.
+#[no_mangle]
+pub unsafe extern "C" fn RefreshTTY() {
+    for cached in &IS_TERMINAL {
+        cached.store(0, Ordering::Relaxed);
+    }
+}
+
+// Whether the stream messages of the given level are written to is a terminal.
+#[no_mangle]
+pub unsafe extern "C" fn IsTerminal(level: LogLevel) -> bool {
+    stream_is_terminal(writes_to_stdout(&level))
+}
+
+// Writes straight to a stream's file descriptor. io::Stdout and io::Stderr report writes to a
+// closed descriptor (EBADF) as successful, which would hide a stream closed by the program.
+struct RawStream(ffi::c_int);
+
+impl RawStream {
+    fn stdout() -> Self {
+        RawStream(1)
+    }
+
+    fn stderr() -> Self {
+        RawStream(2)
+    }
+}
+
+impl Write for RawStream {
+    fn write(&mut self, buf: &[u8]) -> io::Result<usize> {
+        // The descriptor is borrowed, it must never be closed here.
+        let mut file = mem::ManuallyDrop::new(unsafe { fs::File::from_raw_fd(self.0) });
+        file.write(buf)
+    }
+
+    fn flush(&mut self) -> io::Result<()> {
+        Ok(())
+    }
+}
+
+// Unlike println!/eprintln!, a failed write (e.g. the stream was closed by daemonization code)
+// must not panic, as that would abort the process at the FFI boundary. The line is dropped and
+// the first failure on each stream is reported once on the other stream.
+fn write_line(to_stdout: bool, args: Arguments) {
+    let line = format!("{}\n", args);
+    let batched = BATCH.with(|batch| match batch.borrow_mut().as_mut() {
+        Some((batch_stdout, text)) if *batch_stdout == to_stdout => {
+            text.push_str(&line);
+            true
+        }
+        _ => false,
+    });
+    if !batched {
+        write_raw(to_stdout, &line);
+    }
+}
+
+fn write_raw(to_stdout: bool, line: &str) {
+    let res = match BUFFERED.lock().unwrap().as_mut() {
+        Some(out) if to_stdout => out.write_all(line.as_bytes()),
+        None if to_stdout => RawStream::stdout().write_all(line.as_bytes()),
+        Some(out) => {
+            let _ = out.flush();
+            RawStream::stderr().write_all(line.as_bytes())
+        }
+        None => RawStream::stderr().write_all(line.as_bytes()),
+    };
+
+    let (failed, idx, mut other) = if to_stdout {
+        ("stdout", 0, RawStream::stderr())
+    } else {
+        ("stderr", 1, RawStream::stdout())
+    };
+
+    if res.is_err() && !WRITE_FAILED[idx].swap(true, Ordering::Relaxed) {
+        let _ = writeln!(
+            other,
+            "{}[WARN] logger: writing to {} failed, further output to it is dropped{}",
+            paint(COLOR_WARN),
+            failed,
+            paint(RESET),
+        );
     }
 }
 
 unsafe fn log(log_level: LogLevel, header: &str, msg: String, color: &str, style: Option<&str>) {
+    let sanitize = SANITIZE_INPUT.load(Ordering::Relaxed);
+    log_message(log_level, header, msg, color, style, sanitize)
+}
+
+unsafe fn log_message(
+    log_level: LogLevel,
+    header: &str,
+    msg: String,
+    color: &str,
+    style: Option<&str>,
+    sanitize_input: bool,
+) {
     let ptr = CONFIG.load(Ordering::Acquire);
     if ptr.is_null() {
         return;
@@ -411,17 +1359,16 @@ unsafe fn log(log_level: LogLevel, header: &str, msg: String, color: &str, style
 
     let cfg = &*ptr;
 
-    let logger_fn = |args: Arguments| {
-        if log_level == LogLevel::LPanic {
-            // TODO: Handle panic with special care
-            eprintln!("{}", args);
-        } else if log_level >= LogLevel::LWarn {
-            eprintln!("{}", args);
-        } else {
-            println!("{}", args);
-        }
+    let colored = colors_enabled() && log_level as u64 >= MIN_COLOR_LEVEL.load(Ordering::Relaxed);
+    let (color, style, reset) = if colored {
+        (color, style.unwrap_or(""), RESET)
+    } else {
+        ("", "", "")
     };
 
+    let to_stdout = writes_to_stdout(&log_level);
+    let logger_fn = |args: Arguments| write_line(to_stdout, args);
+
     macro_rules! logger {
         ($($arg:tt)*) => {
             logger_fn(format_args!($($arg)*))
@@ -429,63 +1376,295 @@ unsafe fn log(log_level: LogLevel, header: &str, msg: String, color: &str, style
     }
 
     if log_level >= cfg.level {
+        // Like the line cap below, sampling only limits output and configured actions still run.
+        let (keep, dropped) = sample(&log_level);
+        if !keep {
+            handle_action(&log_level, &msg);
+            return;
+        }
+
+        // Fatal and Panic terminate the process, so they are never throttled. The cap only limits
+        // output: configured actions still run so alerts aren't lost.
+        if log_level < LogLevel::LFatal && over_line_rate() {
+            handle_action(&log_level, &msg);
+            return;
+        }
+
         let slice = slice::from_raw_parts(msg.data as *const u8, msg.len as usize);
         if let Ok(message) = str::from_utf8(slice) {
-            match cfg.style {
-                LogStyle::SBrackets => {
+            let label = match cfg.style {
+                LogStyle::SBrackets => format!("[{}] ", header),
+                LogStyle::SColon => format!("{}: ", header),
+                LogStyle::SNone => string::String::new(),
+            };
+
+            if log_level == LogLevel::LError {
+                let (duplicate, repeats) = duplicate_error(message);
+                if duplicate {
                     handle_action(&log_level, &msg);
-                    if log_level >= LogLevel::LFatal {
-                        logger!(
-                            "{}{}[{}] {}{}",
-                            color,
-                            style.unwrap(),
-                            header,
-                            message,
-                            RESET,
-                        );
-
-                        drain_pending();
-                        process::exit(1);
-                    }
-                    logger!("{}[{}] {}{}", color, header, message, RESET);
+                    return;
                 }
-                LogStyle::SColon => {
-                    handle_action(&log_level, &msg);
-                    if log_level >= LogLevel::LFatal {
-                        logger!(
-                            "{}{}{}: {}{}",
-                            color,
-                            style.unwrap(),
-                            header,
-                            message,
-                            RESET,
-                        );
-
-                        drain_pending();
-                        process::exit(1);
-                    }
-                    logger!("{}{}: {}{}", color, header, message, RESET);
+                if repeats > 0 {
+                    logger!(
+                        "{}{}previous error repeated {} more time(s){}",
+                        color,
+                        label,
+                        repeats,
+                        reset,
+                    );
                 }
-                LogStyle::SNone => {
-                    handle_action(&log_level, &msg);
-                    if log_level >= LogLevel::LFatal {
-                        logger!("{}{}{}{}", color, style.unwrap(), message, RESET);
+            }
 
-                        drain_pending();
-                        process::exit(1);
-                    }
-                    logger!("{}{}{}", color, message, RESET);
+            let debug_prefix = DEBUG_PREFIX.load(Ordering::Relaxed);
+            let seq = if debug_prefix || SEQUENCE_NUMBERS.load(Ordering::Relaxed) {
+                SEQUENCE.fetch_add(1, Ordering::Relaxed) + 1
+            } else {
+                0
+            };
+
+            let prefix = if debug_prefix {
+                let elapsed = DEBUG_START.get_or_init(Instant::now).elapsed().as_millis();
+                let separator = match cfg.style {
+                    LogStyle::SBrackets => "",
+                    _ => " ",
+                };
+                format!("[{:04} +{}ms]{}{}", seq, elapsed, separator, label)
+            } else {
+                label.clone()
+            };
+
+            // Switch from the label color to the message color right after the prefix.
+            let prefix = match MESSAGE_COLOR.lock().unwrap()[log_level as usize].as_deref() {
+                Some(message_color) if colored => {
+                    format!("{}{}{}{}", prefix, reset, style, message_color)
+                }
+                _ => prefix,
+            };
+
+            let message = if sanitize_input {
+                sanitize(message)
+            } else {
+                message.to_owned()
+            };
+
+            let mut fields = string::String::new();
+            if INCLUDE_PID.load(Ordering::Relaxed) {
+                fields.push_str(&format!(" pid={}", process::id()));
+            }
+            if INCLUDE_HOSTNAME.load(Ordering::Relaxed) {
+                fields.push_str(&format!(" host={}", hostname()));
+            }
+            if INCLUDE_BUILD_INFO.load(Ordering::Relaxed) {
+                fields.push_str(&BUILD_INFO.lock().unwrap());
+            }
+            if SEQUENCE_NUMBERS.load(Ordering::Relaxed) {
+                fields.push_str(&format!(" seq={}", seq));
+            }
+
+            // Filters see the line without colors, Fatal and Panic are never hidden.
+            if log_level < LogLevel::LFatal
+                && filtered_out(|| format!("{}{}{}", label, message, fields))
+            {
+                handle_action(&log_level, &msg);
+                return;
+            }
+
+            let message = if PREFIX_EACH_LINE.load(Ordering::Relaxed) && message.contains('\n') {
+                let separator = format!("{}\n{}{}{}", reset, color, style, prefix);
+                message.split('\n').collect::<Vec<_>>().join(&separator)
+            } else {
+                message
+            };
+
+            let wrap = WRAP.load(Ordering::Relaxed);
+            let ring_bell = log_level >= LogLevel::LError && BELL_ON_ERROR.load(Ordering::Relaxed);
+            let is_tty = (wrap || ring_bell) && stream_is_terminal(to_stdout);
+
+            let wrap_width = match WRAP_WIDTH.load(Ordering::Relaxed) {
+                0 if wrap && is_tty => terminal_width(to_stdout),
+                n => n as usize,
+            };
+            let message = if wrap && is_tty && wrap_width > 0 {
+                wrap_message(&message, visible_width(&prefix), wrap_width)
+            } else {
+                message
+            };
+
+            let bell = if is_tty && ring_bell { "\x07" } else { "" };
+
+            if !fields.is_empty() && colored {
+                if let Some(field_color) = FIELD_COLOR.lock().unwrap().as_deref() {
+                    fields = format!("{}{}{}", reset, field_color, fields);
+                }
+            }
+
+            handle_action(&log_level, &msg);
+            if log_level >= LogLevel::LFatal {
+                logger!(
+                    "{}{}{}{}{}{}{}",
+                    bell,
+                    color,
+                    style,
+                    prefix,
+                    message,
+                    fields,
+                    reset,
+                );
+
+                drain_pending();
+                let on_fatal = *ON_FATAL.lock().unwrap();
+                if let Some(f) = on_fatal {
+                    f();
+                }
+                Flush();
+
+                let exit = *EXIT_FUNC.lock().unwrap();
+                match exit {
+                    Some(f) => f(1),
+                    None => process::exit(1),
                 }
+                return;
+            }
+            logger!("{}{}{}{}{}{}", bell, color, prefix, message, fields, reset);
+            if log_level >= LogLevel::LError && FLUSH_ON_ERROR.load(Ordering::Relaxed) {
+                Flush();
+            }
+
+            if dropped > 0 {
+                logger!(
+                    "{}{}{} message(s) dropped by sampling{}",
+                    color,
+                    label,
+                    dropped,
+                    reset,
+                );
             }
         }
+    } else {
+        suppressed(log_level, msg);
+    }
+}
+
+// Header, color and extra style each level is written with.
+fn level_format(level: &LogLevel) -> (&'static str, &'static str, Option<&'static str>) {
+    match level {
+        LogLevel::LDebug => ("DEBUG", COLOR_DEBUG, None),
+        LogLevel::LOkay => ("OK", COLOR_OKAY, None),
+        LogLevel::LInfo => ("INFO", COLOR_INFO, None),
+        LogLevel::LWarn => ("WARN", COLOR_WARN, None),
+        LogLevel::LError => ("ERROR", COLOR_ERROR, None),
+        LogLevel::LFatal => ("FATAL", COLOR_ERROR, Some(STYLE_BOLD)),
+        LogLevel::LPanic => ("PANIC", COLOR_ERROR, Some(STYLE_ITALIC)),
     }
 }
 
+#[no_mangle]
+pub unsafe extern "C" fn Log(level: LogLevel, msg: String) {
+    let (header, color, style) = level_format(&level);
+    log(level, header, msg, color, style)
+}
+
+// Replaces the status code to level mapping used by LogHTTPStatus, NULL restores the default.
+#[no_mangle]
+pub unsafe extern "C" fn SetStatusLevelFunc(
+    f: Option<unsafe extern "C" fn(ffi::c_int) -> LogLevel>,
+) {
+    *STATUS_LEVEL_FUNC.lock().unwrap() = f;
+}
+
+// Logs at a level picked from the HTTP status class: 2xx is Okay, 3xx Info, 4xx Warn and 5xx
+// Error. Anything else is logged as Info.
+#[no_mangle]
+pub unsafe extern "C" fn LogHTTPStatus(code: ffi::c_int, msg: String) {
+    let status_level = *STATUS_LEVEL_FUNC.lock().unwrap();
+    let level = match status_level {
+        Some(f) => f(code),
+        None => match code {
+            200..=299 => LogLevel::LOkay,
+            400..=499 => LogLevel::LWarn,
+            500..=599 => LogLevel::LError,
+            _ => LogLevel::LInfo,
+        },
+    };
+    Log(level, msg)
+}
+
+// Logs a single message in the given color escape instead of the level's own. The override is
+// ignored when colors are disabled.
+#[no_mangle]
+pub unsafe extern "C" fn LogColor(level: LogLevel, ansi: String, msg: String) {
+    let (header, _, style) = level_format(&level);
+    let code = slice::from_raw_parts(ansi.data as *const u8, ansi.len as usize);
+    log(
+        level,
+        header,
+        msg,
+        &fit_color_depth(str::from_utf8(code).unwrap_or("")),
+        style,
+    )
+}
+
 #[no_mangle]
 pub unsafe extern "C" fn Debug(msg: String) {
     log(LogLevel::LDebug, "DEBUG", msg, COLOR_DEBUG, None)
 }
 
+// Logs a hex and ASCII dump of the data at Debug level, in the same layout as Go's hex.Dump.
+#[no_mangle]
+pub unsafe extern "C" fn DebugHex(label: String, data: *const u8, len: usize) {
+    let ptr = CONFIG.load(Ordering::Acquire);
+    if ptr.is_null() {
+        return;
+    }
+    if LogLevel::LDebug < (*ptr).level {
+        suppressed(LogLevel::LDebug, label);
+        return;
+    }
+
+    let label = slice::from_raw_parts(label.data as *const u8, label.len as usize);
+    let data: &[u8] = if data.is_null() {
+        &[]
+    } else {
+        slice::from_raw_parts(data, len)
+    };
+
+    // The dump itself is multi-line by design, so only the label is sanitized.
+    let label = string::String::from_utf8_lossy(label);
+    let mut dump = if SANITIZE_INPUT.load(Ordering::Relaxed) {
+        sanitize(&label)
+    } else {
+        label.into_owned()
+    };
+    for (i, chunk) in data.chunks(16).enumerate() {
+        dump.push_str(&format!("\n{:08x} ", i * 16));
+        for j in 0..16 {
+            if j == 8 {
+                dump.push(' ');
+            }
+            match chunk.get(j) {
+                Some(b) => dump.push_str(&format!(" {:02x}", b)),
+                None => dump.push_str("   "),
+            }
+        }
+
+        dump.push_str("  |");
+        for &b in chunk {
+            dump.push(if b.is_ascii_graphic() || b == b' ' {
+                b as char
+            } else {
+                '.'
+            });
+        }
+        dump.push('|');
+    }
+
+    let msg = String {
+        data: dump.as_ptr() as *const ffi::c_char,
+        len: dump.len() as i64,
+    };
+    log_message(LogLevel::LDebug, "DEBUG", msg, COLOR_DEBUG, None, false)
+}
+
 #[no_mangle]
 pub unsafe extern "C" fn Info(msg: String) {
     log(LogLevel::LInfo, "INFO", msg, COLOR_INFO, None)
@@ -527,3 +1706,54 @@ pub unsafe extern "C" fn Panic(msg: String) {
         Some(STYLE_ITALIC),
     )
 }
+
+// Formats every message like the single message call would, then writes all lines with one
+// write. Lines for the other stream, such as a notice, are written on their own.
+unsafe fn log_batch(level: LogLevel, msgs: *const String, n: usize) {
+    if msgs.is_null() || n == 0 {
+        return;
+    }
+
+    let to_stdout = writes_to_stdout(&level);
+    BATCH.with(|batch| *batch.borrow_mut() = Some((to_stdout, string::String::new())));
+
+    let (header, color, style) = level_format(&level);
+    for msg in slice::from_raw_parts(msgs, n) {
+        let msg = String {
+            data: msg.data,
+            len: msg.len,
+        };
+        log(level, header, msg, color, style);
+    }
+
+    if let Some((_, text)) = BATCH.with(|batch| batch.borrow_mut().take()) {
+        if !text.is_empty() {
+            write_raw(to_stdout, &text);
+        }
+    }
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn DebugBatch(msgs: *const String, n: usize) {
+    log_batch(LogLevel::LDebug, msgs, n)
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn OkayBatch(msgs: *const String, n: usize) {
+    log_batch(LogLevel::LOkay, msgs, n)
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn InfoBatch(msgs: *const String, n: usize) {
+    log_batch(LogLevel::LInfo, msgs, n)
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn WarnBatch(msgs: *const String, n: usize) {
+    log_batch(LogLevel::LWarn, msgs, n)
+}
+
+#[no_mangle]
+pub unsafe extern "C" fn ErrorBatch(msgs: *const String, n: usize) {
+    log_batch(LogLevel::LError, msgs, n)
+}
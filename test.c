@@ -1,11 +1,101 @@
 #include <stdio.h>
 #include <stdlib.h>
 #include <string.h>
+#include <sys/wait.h>
+#include <unistd.h>
 #define STRING_IMPLEMENTATION
 #include "logger.h"
 
+// With NO_COLOR set, no line may contain an escape, including the logger's own
+// notices. The environment is only read once, so this runs in a child process
+// before anything else logs.
+void test_no_color(String msg) {
+  FILE *captured = tmpfile();
+  pid_t pid = fork();
+  if (pid == 0) {
+    setenv("NO_COLOR", "1", 1);
+    unsetenv("FORCE_COLOR");
+    dup2(fileno(captured), STDOUT_FILENO);
+    dup2(fileno(captured), STDERR_FILENO);
+
+    Configure(LDebug, SBrackets, NULL);
+    Debug(msg);
+    Info(msg);
+    Okay(msg);
+    Warn(msg);
+    Error(msg);
+
+    SetLevelSampling(LDebug, 2);
+    for (int i = 0; i < 3; i++) {
+      Debug(msg);
+    }
+    SetLevelSampling(LDebug, 1);
+
+    SetMaxLinesPerSecond(1);
+    Info(msg);
+    Info(msg);
+    SetMaxLinesPerSecond(0);
+
+    close(STDOUT_FILENO);
+    Info(msg);
+    Fatal(msg);
+  }
+  waitpid(pid, NULL, 0);
+
+  char buf[4096] = {0};
+  rewind(captured);
+  size_t n = fread(buf, 1, sizeof(buf) - 1, captured);
+  fclose(captured);
+
+  const char *notices[] = {"dropped by sampling", "dropping output",
+                           "writing to stdout failed", "[FATAL]"};
+  for (size_t i = 0; i < sizeof(notices) / sizeof(notices[0]); i++) {
+    if (strstr(buf, notices[i]) == NULL) {
+      fprintf(stderr, "no color: missing \"%s\", got:\n%s", notices[i], buf);
+      exit(1);
+    }
+  }
+  if (memchr(buf, '\033', n) != NULL) {
+    fprintf(stderr, "no color: output contains an escape:\n%s", buf);
+    exit(1);
+  }
+  printf("no color: ok\n");
+}
+
+// Logging to a closed stdout must not crash, it only warns once on stderr.
+void test_closed_stdout(String msg) {
+  int saved_out = dup(STDOUT_FILENO);
+  int saved_err = dup(STDERR_FILENO);
+  FILE *captured = tmpfile();
+  dup2(fileno(captured), STDERR_FILENO);
+  close(STDOUT_FILENO);
+
+  Configure(LDebug, SBrackets, NULL);
+  Info(msg);
+  Info(msg);
+
+  dup2(saved_out, STDOUT_FILENO);
+  dup2(saved_err, STDERR_FILENO);
+  close(saved_out);
+  close(saved_err);
+
+  char buf[1024] = {0};
+  rewind(captured);
+  fread(buf, 1, sizeof(buf) - 1, captured);
+  fclose(captured);
+
+  char *first = strstr(buf, "writing to stdout failed");
+  if (first == NULL || strstr(first + 1, "writing to stdout failed") != NULL) {
+    fprintf(stderr, "closed stdout: expected exactly one warning, got:\n%s", buf);
+    exit(1);
+  }
+  printf("closed stdout: ok\n\n");
+}
+
 int main(void) {
   String msg = string("Addition result: %d", 210 + 210);
+  test_no_color(msg);
+  test_closed_stdout(msg);
 
   char **cc_array = malloc(2 * sizeof(char *));
   cc_array[0] = strdup("work@jelius.dev");